@@ -0,0 +1,308 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pingcap/kvproto/pkg/coprocessor"
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb/expression"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/planner/property"
+	"github.com/pingcap/tidb/sessionctx/stmtctx"
+	"github.com/pingcap/tidb/tablecodec"
+	"github.com/pingcap/tidb/types"
+	"github.com/pingcap/tidb/util/codec"
+	"github.com/pingcap/tidb/util/mock"
+	"github.com/pingcap/tipb/go-tipb"
+)
+
+// Note on coverage: this file exercises clusterTableExtractorFor, the
+// key-range decoding decodeClusterTableRanges feeds into extractor state,
+// the substituteColumnsByIndex fix, the window frame CalcFuncs/CmpFuncs fix,
+// joinSchema, and tableScanToPBExecutor's serialization of an extractor's
+// time range. It stops short of a full tipb.DAGRequest ->
+// PBPlanBuilder.Build -> Explain integration test: that would need a real
+// infoschema.InfoSchema wiring a CLUSTER_* table through to a table.Table
+// whose Type().IsClusterTable() is true.
+
+func TestClusterTableExtractorFor(t *testing.T) {
+	tests := []struct {
+		tblName   string
+		wantNil   bool
+		wantCols  []clusterHandleColumn
+		extractor MemTablePredicateExtractor
+	}{
+		{tblName: "CLUSTER_SLOW_QUERY", wantCols: timeHandleColumns, extractor: &SlowQueryExtractor{}},
+		{tblName: "CLUSTER_LOG", wantCols: instanceTimeHandleColumns, extractor: &ClusterLogTableExtractor{}},
+		{tblName: "CLUSTER_TIDB_TRACE", wantCols: instanceTimeHandleColumns, extractor: &ClusterLogTableExtractor{}},
+		{tblName: "CLUSTER_STATEMENTS_SUMMARY", wantCols: instanceHandleColumns, extractor: &ClusterTableExtractor{}},
+		{tblName: "CLUSTER_PROCESSLIST", wantCols: instanceHandleColumns, extractor: &ClusterTableExtractor{}},
+		{tblName: "CLUSTER_INFO", wantNil: true},
+	}
+	for _, tt := range tests {
+		extractor, cols := clusterTableExtractorFor(tt.tblName)
+		if tt.wantNil {
+			if extractor != nil {
+				t.Errorf("%s: expected no extractor, got %T", tt.tblName, extractor)
+			}
+			continue
+		}
+		if extractor == nil {
+			t.Fatalf("%s: expected an extractor, got none", tt.tblName)
+		}
+		wantTp := fmtType(tt.extractor)
+		gotTp := fmtType(extractor)
+		if wantTp != gotTp {
+			t.Errorf("%s: expected extractor type %s, got %s", tt.tblName, wantTp, gotTp)
+		}
+		if len(cols) != len(tt.wantCols) {
+			t.Errorf("%s: expected %d handle columns, got %d", tt.tblName, len(tt.wantCols), len(cols))
+		}
+	}
+}
+
+func fmtType(v interface{}) string {
+	switch v.(type) {
+	case *SlowQueryExtractor:
+		return "*SlowQueryExtractor"
+	case *ClusterLogTableExtractor:
+		return "*ClusterLogTableExtractor"
+	case *ClusterTableExtractor:
+		return "*ClusterTableExtractor"
+	default:
+		return "unknown"
+	}
+}
+
+// encodeHandleCols codec-encodes each datum and concatenates them the way
+// kv.NewCommonHandle expects, so decodeHandleColumns can pull each column's
+// bytes back out via handle.EncodedCol(i).
+func encodeHandleCols(sc *stmtctx.StatementContext, datums ...types.Datum) kv.Handle {
+	var encoded []byte
+	for _, d := range datums {
+		var err error
+		encoded, err = codec.EncodeKey(sc, encoded, d)
+		if err != nil {
+			panic(err)
+		}
+	}
+	handle, err := kv.NewCommonHandle(encoded)
+	if err != nil {
+		panic(err)
+	}
+	return handle
+}
+
+func rowKeyRange(tableID int64, sc *stmtctx.StatementContext, startDatums, endDatums []types.Datum) *coprocessor.KeyRange {
+	start := tablecodec.EncodeRowKeyWithHandle(tableID, encodeHandleCols(sc, startDatums...))
+	end := tablecodec.EncodeRowKeyWithHandle(tableID, encodeHandleCols(sc, endDatums...))
+	return &coprocessor.KeyRange{Start: start, End: end}
+}
+
+func TestDecodeClusterTableRangesTimeOnly(t *testing.T) {
+	sctx := mock.NewContext()
+	sc := sctx.GetSessionVars().StmtCtx
+	b := NewPBPlanBuilder(sctx, nil, nil)
+
+	startTime := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	endTime := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	startDatum := types.NewTimeDatum(types.NewTime(types.FromGoTime(startTime), mysql.TypeDatetime, types.MaxFsp))
+	endDatum := types.NewTimeDatum(types.NewTime(types.FromGoTime(endTime), mysql.TypeDatetime, types.MaxFsp))
+	kr := rowKeyRange(1, sc, []types.Datum{startDatum}, []types.Datum{endDatum})
+
+	extractor := &SlowQueryExtractor{}
+	if err := b.decodeClusterTableRanges([]*coprocessor.KeyRange{kr}, timeHandleColumns, extractor); err != nil {
+		t.Fatalf("decodeClusterTableRanges: %v", err)
+	}
+	if extractor.StartTime.IsZero() || extractor.EndTime.IsZero() {
+		t.Errorf("expected the extractor's time range to be set from the key range, got start=%v end=%v", extractor.StartTime, extractor.EndTime)
+	}
+}
+
+// TestDecodeClusterTableRangesUndecodableTime guards against the bug fixed
+// in [TszKitLo40/tidb#chunk0-2]: when a handle column fails to decode as a
+// time value (e.g. a cross-node DAG whose handle was actually built for a
+// different table), decodeClusterTableRanges must leave the extractor's
+// time range unset instead of calling GetMysqlTime on a zero Datum.
+func TestDecodeClusterTableRangesUndecodableTime(t *testing.T) {
+	sctx := mock.NewContext()
+	sc := sctx.GetSessionVars().StmtCtx
+	b := NewPBPlanBuilder(sctx, nil, nil)
+
+	// A string-encoded handle column where timeHandleColumns expects a
+	// datetime: DecodeOne fails to decode it as TypeDatetime, leaving that
+	// slot at its zero Datum.
+	kr := rowKeyRange(1, sc, []types.Datum{types.NewStringDatum("not-a-time")}, []types.Datum{types.NewStringDatum("not-a-time")})
+
+	extractor := &SlowQueryExtractor{}
+	if err := b.decodeClusterTableRanges([]*coprocessor.KeyRange{kr}, timeHandleColumns, extractor); err != nil {
+		t.Fatalf("decodeClusterTableRanges: %v", err)
+	}
+	if !extractor.StartTime.IsZero() || !extractor.EndTime.IsZero() {
+		t.Errorf("expected the extractor's time range to stay unset when the handle column fails to decode, got start=%v end=%v", extractor.StartTime, extractor.EndTime)
+	}
+}
+
+func TestDecodeClusterTableRangesInstanceAndTime(t *testing.T) {
+	sctx := mock.NewContext()
+	sc := sctx.GetSessionVars().StmtCtx
+	b := NewPBPlanBuilder(sctx, nil, nil)
+
+	startTime := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	endTime := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	timeDatum := types.NewTimeDatum(types.NewTime(types.FromGoTime(startTime), mysql.TypeDatetime, types.MaxFsp))
+	endTimeDatum := types.NewTimeDatum(types.NewTime(types.FromGoTime(endTime), mysql.TypeDatetime, types.MaxFsp))
+	instanceDatum := types.NewStringDatum("127.0.0.1:4000")
+	kr := rowKeyRange(1, sc, []types.Datum{instanceDatum, timeDatum}, []types.Datum{instanceDatum, endTimeDatum})
+
+	extractor := &ClusterLogTableExtractor{}
+	if err := b.decodeClusterTableRanges([]*coprocessor.KeyRange{kr}, instanceTimeHandleColumns, extractor); err != nil {
+		t.Fatalf("decodeClusterTableRanges: %v", err)
+	}
+	if len(extractor.Instances) != 1 || extractor.Instances[0] != "127.0.0.1:4000" {
+		t.Errorf("expected Instances to contain the decoded instance, got %v", extractor.Instances)
+	}
+	if extractor.StartTime.IsZero() {
+		t.Errorf("expected the extractor's start time to be set from the key range")
+	}
+}
+
+// TestSubstituteColumnsByIndex guards against the bug where predicates
+// pushed through a reordering/dropping projection were silently left
+// unchanged (see the [TszKitLo40/tidb#chunk0-1] fix commit): a predicate on
+// a projection's second output column must be rewritten in terms of
+// whichever input expression actually sits at that position.
+func TestSubstituteColumnsByIndex(t *testing.T) {
+	sctx := mock.NewContext()
+	// Projection output is (b, a): predicates referencing output column 1
+	// (logically "a") must resolve to the *second* input expression.
+	colA := &expression.Column{UniqueID: 1, Index: 0, RetType: types.NewFieldType(mysql.TypeLonglong)}
+	colB := &expression.Column{UniqueID: 2, Index: 1, RetType: types.NewFieldType(mysql.TypeLonglong)}
+	exprs := []expression.Expression{colB, colA}
+
+	outputCol1 := &expression.Column{Index: 1, RetType: types.NewFieldType(mysql.TypeLonglong)}
+	predicate, err := expression.NewFunction(sctx, ast.GT, types.NewFieldType(mysql.TypeTiny), outputCol1, &expression.Constant{Value: types.NewIntDatum(10), RetType: types.NewFieldType(mysql.TypeLonglong)})
+	if err != nil {
+		t.Fatalf("NewFunction: %v", err)
+	}
+
+	got := substituteColumnsByIndex(predicate, exprs)
+	fn, ok := got.(*expression.ScalarFunction)
+	if !ok {
+		t.Fatalf("expected a scalar function back, got %T", got)
+	}
+	gotCol, ok := fn.GetArgs()[0].(*expression.Column)
+	if !ok {
+		t.Fatalf("expected the substituted predicate's first arg to be a column, got %T", fn.GetArgs()[0])
+	}
+	if gotCol != colA {
+		t.Errorf("expected the predicate to be rewritten against colA (the input at position 1), got a different column")
+	}
+}
+
+// TestBuildFrameBoundFuncs guards against the bug where a Ranges window
+// frame's CalcFuncs/CmpFuncs were left nil (see the
+// [TszKitLo40/tidb#chunk0-1] fix commit), which would panic or compute
+// garbage once the window function actually executed.
+func TestBuildFrameBoundFuncs(t *testing.T) {
+	sctx := mock.NewContext()
+	b := NewPBPlanBuilder(sctx, nil, nil)
+	orderCol := &expression.Column{UniqueID: 1, RetType: types.NewFieldType(mysql.TypeLonglong)}
+	orderBy := []property.SortItem{{Col: orderCol, Desc: false}}
+
+	bound := &FrameBound{Type: ast.Preceding, Num: 1}
+	if err := b.buildFrameBoundFuncs(bound, orderBy); err != nil {
+		t.Fatalf("buildFrameBoundFuncs: %v", err)
+	}
+	if len(bound.CalcFuncs) != 1 || bound.CalcFuncs[0] == nil {
+		t.Fatalf("expected CalcFuncs to be populated, got %v", bound.CalcFuncs)
+	}
+	if len(bound.CmpFuncs) != 1 || bound.CmpFuncs[0] == nil {
+		t.Fatalf("expected CmpFuncs to be populated, got %v", bound.CmpFuncs)
+	}
+}
+
+// TestJoinSchema guards against the bug fixed in [TszKitLo40/tidb#chunk0-1]:
+// semi-join variants don't output the concatenation of both sides' columns,
+// so pbToJoin can't describe their schema with expression.MergeSchema like
+// it does for inner/outer joins.
+func TestJoinSchema(t *testing.T) {
+	sctx := mock.NewContext()
+	b := NewPBPlanBuilder(sctx, nil, nil)
+	left := expression.NewSchema(&expression.Column{UniqueID: 1, RetType: types.NewFieldType(mysql.TypeLonglong)}, &expression.Column{UniqueID: 2, RetType: types.NewFieldType(mysql.TypeLonglong)})
+	right := expression.NewSchema(&expression.Column{UniqueID: 3, RetType: types.NewFieldType(mysql.TypeLonglong)})
+
+	tests := []struct {
+		joinType JoinType
+		wantLen  int
+	}{
+		{InnerJoin, 3},
+		{LeftOuterJoin, 3},
+		{RightOuterJoin, 3},
+		{SemiJoin, 2},
+		{AntiSemiJoin, 2},
+		{LeftOuterSemiJoin, 3},
+		{AntiLeftOuterSemiJoin, 3},
+	}
+	for _, tt := range tests {
+		got := b.joinSchema(tt.joinType, left, right)
+		if got.Len() != tt.wantLen {
+			t.Errorf("joinType %v: expected schema length %d, got %d", tt.joinType, tt.wantLen, got.Len())
+		}
+	}
+}
+
+// TestTableScanToPBExecutorReexpressesExtractor guards against the
+// round-trip fidelity bug fixed in [TszKitLo40/tidb#chunk0-3]: an
+// extractor's absorbed time range has to survive PhysicalPlanToPB as an
+// explicit Selection, since tipb.TableScan itself has no field for it.
+func TestTableScanToPBExecutorReexpressesExtractor(t *testing.T) {
+	sctx := mock.NewContext()
+	b := NewPBPlanBuilder(sctx, nil, nil)
+
+	tblInfo := &model.TableInfo{
+		ID:   1,
+		Name: model.NewCIStr("CLUSTER_SLOW_QUERY"),
+		Columns: []*model.ColumnInfo{
+			{ID: 1, Offset: 0, Name: model.NewCIStr("time"), FieldType: *types.NewFieldType(mysql.TypeDatetime)},
+			{ID: 2, Offset: 1, Name: model.NewCIStr("query"), FieldType: *types.NewFieldType(mysql.TypeVarchar)},
+		},
+	}
+	schema := b.buildTableScanSchema(tblInfo, tblInfo.Columns)
+	p := PhysicalMemTable{Table: tblInfo, Columns: tblInfo.Columns}.Init(sctx, &property.StatsInfo{}, 0)
+	p.SetSchema(schema)
+	p.Extractor = &SlowQueryExtractor{
+		StartTime: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndTime:   time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC),
+	}
+
+	executor, err := b.tableScanToPBExecutor(p)
+	if err != nil {
+		t.Fatalf("tableScanToPBExecutor: %v", err)
+	}
+	if executor.Tp != tipb.ExecType_TypeSelection {
+		t.Fatalf("expected the extractor's time range to resurface as a Selection, got %v", executor.Tp)
+	}
+	if len(executor.Selection.Conditions) != 2 {
+		t.Errorf("expected one condition per time bound, got %d", len(executor.Selection.Conditions))
+	}
+	if len(executor.Children) != 1 || executor.Children[0].Tp != tipb.ExecType_TypeTableScan {
+		t.Errorf("expected the Selection to wrap the original TableScan")
+	}
+}